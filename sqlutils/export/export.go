@@ -0,0 +1,273 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package export streams query results straight from *sql.Rows to an
+// io.Writer as CSV, TSV or newline-delimited JSON, without first buffering
+// them into a sqlutils.ResultData.
+package export
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"io"
+
+	"github.com/ylacancellera/golib/sqlutils"
+)
+
+// Format selects the output encoding for StreamRows.
+type Format int
+
+const (
+	CSV Format = iota
+	TSV
+	NDJSON
+)
+
+// Options controls how StreamRows renders each row.
+type Options struct {
+	// Delimiter separates fields for CSV/TSV output. Zero means "use the
+	// format's default" (',' for CSV, '\t' for TSV). Ignored for NDJSON.
+	Delimiter rune
+	// AlwaysQuote wraps every CSV/TSV field in double quotes, rather than
+	// only the fields that need it. Ignored for NDJSON.
+	AlwaysQuote bool
+	// NullString is how a SQL NULL is rendered in CSV/TSV output. Ignored
+	// for NDJSON, which always renders NULL as JSON null.
+	NullString string
+	// FloatPrecision is the number of digits after the decimal point used
+	// to format float columns. A negative value uses the shortest
+	// representation that round-trips (strconv's 'g' format).
+	FloatPrecision int
+}
+
+func (o Options) delimiter(format Format) rune {
+	if o.Delimiter != 0 {
+		return o.Delimiter
+	}
+	if format == TSV {
+		return '\t'
+	}
+	return ','
+}
+
+// DefaultOptions returns the Options used by WriteCSV, WriteTSV and
+// WriteNDJSON when no customization is needed.
+func DefaultOptions() Options {
+	return Options{NullString: "", FloatPrecision: -1}
+}
+
+// WriteCSV runs query on db and streams the result as CSV to w, with a
+// header row of column names.
+func WriteCSV(ctx context.Context, w io.Writer, db *sql.DB, query string, args ...interface{}) error {
+	return writeFormat(ctx, w, db, CSV, DefaultOptions(), query, args...)
+}
+
+// WriteTSV runs query on db and streams the result as TSV to w, with a
+// header row of column names.
+func WriteTSV(ctx context.Context, w io.Writer, db *sql.DB, query string, args ...interface{}) error {
+	return writeFormat(ctx, w, db, TSV, DefaultOptions(), query, args...)
+}
+
+// WriteNDJSON runs query on db and streams the result to w as
+// newline-delimited JSON, one object per row keyed by column name.
+func WriteNDJSON(ctx context.Context, w io.Writer, db *sql.DB, query string, args ...interface{}) error {
+	return writeFormat(ctx, w, db, NDJSON, DefaultOptions(), query, args...)
+}
+
+func writeFormat(ctx context.Context, w io.Writer, db *sql.DB, format Format, opts Options, query string, args ...interface{}) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	return StreamRows(rows, w, format, opts)
+}
+
+// StreamRows writes rows to w in the given format, scanning and formatting
+// one row at a time so the full result set is never buffered in memory.
+// Column names and count come from rows.ColumnTypes().
+func StreamRows(rows *sql.Rows, w io.Writer, format Format, opts Options) error {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		names[i] = ct.Name()
+	}
+
+	if format != NDJSON {
+		if err := writeDelimitedRow(w, names, opts.delimiter(format), opts.AlwaysQuote); err != nil {
+			return err
+		}
+	}
+
+	values := make([]interface{}, len(names))
+	scanDest := make([]interface{}, len(names))
+	for i := range values {
+		scanDest[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(scanDest...); err != nil {
+			return err
+		}
+		if format == NDJSON {
+			if err := writeJSONRow(w, names, values, opts); err != nil {
+				return err
+			}
+			continue
+		}
+		fields := make([]string, len(values))
+		for i, v := range values {
+			fields[i] = formatField(v, opts)
+		}
+		if err := writeDelimitedRow(w, fields, opts.delimiter(format), opts.AlwaysQuote); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// WriteNamedResultData writes an already-buffered sqlutils.NamedResultData
+// (e.g. from sqlutils.QueryNamedResultData or sqlutils.ScanTable) to w in
+// the given format, using data.Columns for the header row/JSON keys. Unlike
+// StreamRows, every value here is already a sqlutils.CellData, so it's
+// rendered as a string (or NullString/JSON null when not Valid) rather than
+// going through database/sql's typed scanning.
+func WriteNamedResultData(w io.Writer, data sqlutils.NamedResultData, format Format, opts Options) error {
+	if format != NDJSON {
+		if err := writeDelimitedRow(w, data.Columns, opts.delimiter(format), opts.AlwaysQuote); err != nil {
+			return err
+		}
+	}
+
+	for _, row := range data.Data {
+		values := make([]interface{}, len(row))
+		for i, cell := range row {
+			if cell.Valid {
+				values[i] = cell.String
+			}
+		}
+		if format == NDJSON {
+			if err := writeJSONRow(w, data.Columns, values, opts); err != nil {
+				return err
+			}
+			continue
+		}
+		fields := make([]string, len(values))
+		for i, v := range values {
+			fields[i] = formatField(v, opts)
+		}
+		if err := writeDelimitedRow(w, fields, opts.delimiter(format), opts.AlwaysQuote); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatField renders a single scanned column value as text, per the
+// conventions described in Options.
+func formatField(v interface{}, opts Options) string {
+	switch val := v.(type) {
+	case nil:
+		return opts.NullString
+	case []byte:
+		return string(val)
+	case string:
+		return val
+	case bool:
+		return strconv.FormatBool(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		if opts.FloatPrecision >= 0 {
+			return strconv.FormatFloat(val, 'f', opts.FloatPrecision, 64)
+		}
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case time.Time:
+		return val.Format(sqlutils.DateTimeFormat)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+// jsonValue renders a single scanned column value as a JSON-marshalable Go
+// value, preserving numeric/boolean types instead of stringifying them.
+func jsonValue(v interface{}, opts Options) interface{} {
+	switch val := v.(type) {
+	case []byte:
+		return string(val)
+	case float64:
+		if opts.FloatPrecision >= 0 {
+			return json.Number(strconv.FormatFloat(val, 'f', opts.FloatPrecision, 64))
+		}
+		return val
+	case time.Time:
+		return val.Format(sqlutils.DateTimeFormat)
+	default:
+		return val
+	}
+}
+
+func writeJSONRow(w io.Writer, names []string, values []interface{}, opts Options) error {
+	obj := make(map[string]interface{}, len(names))
+	for i, name := range names {
+		obj[name] = jsonValue(values[i], opts)
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// writeDelimitedRow writes fields separated by delimiter, RFC4180-style:
+// a field is quoted if it contains the delimiter, a quote, or a newline (or
+// always, if alwaysQuote is set), with embedded quotes doubled.
+func writeDelimitedRow(w io.Writer, fields []string, delimiter rune, alwaysQuote bool) error {
+	var sb strings.Builder
+	for i, field := range fields {
+		if i > 0 {
+			sb.WriteRune(delimiter)
+		}
+		if alwaysQuote || needsQuoting(field, delimiter) {
+			sb.WriteByte('"')
+			sb.WriteString(strings.ReplaceAll(field, `"`, `""`))
+			sb.WriteByte('"')
+		} else {
+			sb.WriteString(field)
+		}
+	}
+	sb.WriteByte('\n')
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func needsQuoting(field string, delimiter rune) bool {
+	return strings.ContainsRune(field, delimiter) ||
+		strings.ContainsAny(field, "\"\n\r")
+}
@@ -0,0 +1,124 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package export
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ylacancellera/golib/sqlutils"
+)
+
+func TestWriteJSONRowHonorsFloatPrecision(t *testing.T) {
+	var sb strings.Builder
+	opts := Options{FloatPrecision: 2}
+	if err := writeJSONRow(&sb, []string{"amount"}, []interface{}{3.14159}, opts); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	var row map[string]json.Number
+	if err := json.Unmarshal([]byte(sb.String()), &row); err != nil {
+		t.Fatalf("unexpected error unmarshaling output: %+v", err)
+	}
+	if row["amount"].String() != "3.14" {
+		t.Fatalf("expected amount to be rounded to 2 decimals, got %s", row["amount"].String())
+	}
+}
+
+func TestWriteJSONRowDefaultFloatPrecision(t *testing.T) {
+	var sb strings.Builder
+	if err := writeJSONRow(&sb, []string{"amount"}, []interface{}{3.5}, DefaultOptions()); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if strings.TrimSpace(sb.String()) != `{"amount":3.5}` {
+		t.Fatalf("unexpected output: %s", sb.String())
+	}
+}
+
+func TestFormatFieldNullString(t *testing.T) {
+	opts := Options{NullString: "\\N"}
+	if got := formatField(nil, opts); got != "\\N" {
+		t.Fatalf("expected NullString rendering, got %q", got)
+	}
+}
+
+func namedResultDataFixture() sqlutils.NamedResultData {
+	return sqlutils.NamedResultData{
+		Columns: []string{"id", "name"},
+		Data: sqlutils.ResultData{
+			sqlutils.RowData{
+				sqlutils.CellData{Valid: true, String: "1"},
+				sqlutils.CellData{Valid: true, String: "alice"},
+			},
+			sqlutils.RowData{
+				sqlutils.CellData{Valid: true, String: "2"},
+				sqlutils.CellData{Valid: false},
+			},
+		},
+	}
+}
+
+func TestWriteNamedResultDataCSV(t *testing.T) {
+	var sb strings.Builder
+	if err := WriteNamedResultData(&sb, namedResultDataFixture(), CSV, DefaultOptions()); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	want := "id,name\n1,alice\n2,\n"
+	if sb.String() != want {
+		t.Fatalf("got %q, want %q", sb.String(), want)
+	}
+}
+
+func TestWriteNamedResultDataNDJSON(t *testing.T) {
+	var sb strings.Builder
+	if err := WriteNamedResultData(&sb, namedResultDataFixture(), NDJSON, DefaultOptions()); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), sb.String())
+	}
+
+	var first map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if first["id"] != "1" || first["name"] != "alice" {
+		t.Fatalf("unexpected first row: %+v", first)
+	}
+
+	var second map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if second["id"] != "2" || second["name"] != nil {
+		t.Fatalf("unexpected second row: %+v", second)
+	}
+}
+
+func TestWriteNamedResultDataUsesNullString(t *testing.T) {
+	var sb strings.Builder
+	opts := Options{NullString: "\\N"}
+	if err := WriteNamedResultData(&sb, namedResultDataFixture(), CSV, opts); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if !strings.Contains(sb.String(), "2,\\N\n") {
+		t.Fatalf("expected NULL row to use NullString, got %q", sb.String())
+	}
+}
@@ -0,0 +1,152 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package sqlutils
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Observer is notified around every query/exec run through this package's
+// QueryRowsMap*, QueryResultData*, QueryNamedResultData*, QueryRowsMapBuffered*,
+// ExecNoPrepare*, Exec* and ExecSilently* helpers. The struct-scanning,
+// named-parameter and transaction helpers (GetStruct, SelectStructs,
+// NamedQuery, NamedExec, TxQueryRowsMap, TxExec) do not notify observers.
+// OnQueryStart may return a derived context (e.g. carrying a
+// tracing span) that is threaded through to the query itself and to the
+// matching OnQueryEnd call.
+type Observer interface {
+	OnQueryStart(ctx context.Context, query string) context.Context
+	OnQueryEnd(ctx context.Context, query string, rowsAffected int64, err error)
+}
+
+type observerContextKey int
+
+const (
+	queryStartedAtKey observerContextKey = iota
+	queryDriverNameKey
+)
+
+// QueryStartedAt returns the time the currently-observed query began, as
+// recorded by this package before the first Observer.OnQueryStart call.
+func QueryStartedAt(ctx context.Context) (time.Time, bool) {
+	t, ok := ctx.Value(queryStartedAtKey).(time.Time)
+	return t, ok
+}
+
+// QueryDriverName returns the database/sql driver name of the DB the
+// currently-observed query is running against, if known.
+func QueryDriverName(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(queryDriverNameKey).(string)
+	return name, ok
+}
+
+var (
+	globalObserversMutex = &sync.Mutex{}
+	globalObservers      []Observer
+)
+
+// RegisterObserver adds o to the set of observers notified around every
+// query run through this package's observed helpers (see Observer),
+// regardless of which DB it runs against. See DBRegistry.RegisterObserver to scope an observer to a single
+// DB instead.
+func RegisterObserver(o Observer) {
+	globalObserversMutex.Lock()
+	defer globalObserversMutex.Unlock()
+	globalObservers = append(globalObservers, o)
+}
+
+var (
+	dbObserversMutex = &sync.Mutex{}
+	dbObservers      = make(map[*sql.DB][]Observer)
+	dbDriverNames    = make(map[*sql.DB]string)
+)
+
+func registerDBDriverName(db *sql.DB, driverName string) {
+	dbObserversMutex.Lock()
+	defer dbObserversMutex.Unlock()
+	dbDriverNames[db] = driverName
+}
+
+func driverNameForDB(db *sql.DB) (string, bool) {
+	dbObserversMutex.Lock()
+	defer dbObserversMutex.Unlock()
+	name, ok := dbDriverNames[db]
+	return name, ok
+}
+
+func registerDBObserver(db *sql.DB, o Observer) {
+	dbObserversMutex.Lock()
+	defer dbObserversMutex.Unlock()
+	dbObservers[db] = append(dbObservers[db], o)
+}
+
+func observersForDB(db *sql.DB) []Observer {
+	globalObserversMutex.Lock()
+	observers := make([]Observer, len(globalObservers))
+	copy(observers, globalObservers)
+	globalObserversMutex.Unlock()
+
+	dbObserversMutex.Lock()
+	observers = append(observers, dbObservers[db]...)
+	dbObserversMutex.Unlock()
+	return observers
+}
+
+var (
+	redactStringLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+	redactNumberLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+)
+
+// redactQuery replaces quoted string and numeric literals in query with
+// `?`, producing a stable fingerprint that is safe to use as a metrics
+// label or trace attribute.
+func redactQuery(query string) string {
+	redacted := redactStringLiteral.ReplaceAllString(query, "?")
+	redacted = redactNumberLiteral.ReplaceAllString(redacted, "?")
+	return redacted
+}
+
+// observeQuery runs fn, which performs the actual query/exec, wrapped with
+// OnQueryStart/OnQueryEnd notifications to every observer registered
+// globally or on db. fn returns the number of rows affected/read and
+// whatever error the query produced; both are reported to OnQueryEnd.
+func observeQuery(ctx context.Context, db *sql.DB, query string, fn func(ctx context.Context) (rowsAffected int64, err error)) (int64, error) {
+	observers := observersForDB(db)
+	if len(observers) == 0 {
+		return fn(ctx)
+	}
+
+	fingerprint := redactQuery(query)
+	ctx = context.WithValue(ctx, queryStartedAtKey, time.Now())
+	if driverName, ok := driverNameForDB(db); ok {
+		ctx = context.WithValue(ctx, queryDriverNameKey, driverName)
+	}
+	for _, o := range observers {
+		ctx = o.OnQueryStart(ctx, fingerprint)
+	}
+
+	rowsAffected, err := fn(ctx)
+
+	for _, o := range observers {
+		o.OnQueryEnd(ctx, fingerprint, rowsAffected, err)
+	}
+	return rowsAffected, err
+}
@@ -0,0 +1,71 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package otel provides a sqlutils.Observer that records each query as an
+// OpenTelemetry span.
+package otel
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ylacancellera/golib/sqlutils"
+)
+
+type spanContextKey struct{}
+
+// Observer is a sqlutils.Observer that starts a span per query, tagged with
+// the driver name and a literal-redacted query fingerprint, and records the
+// row count and any error on the span before ending it.
+type Observer struct {
+	tracer trace.Tracer
+}
+
+// New returns an Observer whose spans are created from the tracer named
+// tracerName.
+func New(tracerName string) *Observer {
+	return &Observer{tracer: otel.Tracer(tracerName)}
+}
+
+// OnQueryStart implements sqlutils.Observer.
+func (this *Observer) OnQueryStart(ctx context.Context, query string) context.Context {
+	ctx, span := this.tracer.Start(ctx, "sql.query", trace.WithAttributes(
+		attribute.String("db.statement", query),
+	))
+	if driverName, ok := sqlutils.QueryDriverName(ctx); ok {
+		span.SetAttributes(attribute.String("db.system", driverName))
+	}
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+// OnQueryEnd implements sqlutils.Observer.
+func (this *Observer) OnQueryEnd(ctx context.Context, query string, rowsAffected int64, err error) {
+	span, ok := ctx.Value(spanContextKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	span.SetAttributes(attribute.Int64("db.rows_affected", rowsAffected))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
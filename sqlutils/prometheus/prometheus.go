@@ -0,0 +1,103 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package prometheus provides a sqlutils.Observer that records query
+// duration and error counts as Prometheus metrics.
+package prometheus
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/ylacancellera/golib/sqlutils"
+)
+
+// Observer is a sqlutils.Observer and a prometheus.Collector: register it
+// with both sqlutils.RegisterObserver (or DBRegistry.RegisterObserver) and
+// a prometheus.Registerer.
+type Observer struct {
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+}
+
+// New returns an Observer whose metrics are labeled with the driver name and
+// a bounded query fingerprint: a hash of the literal-redacted query text,
+// not the text itself. Using the redacted text verbatim as a label value
+// would let every distinct query shape create its own Prometheus time
+// series, an unbounded-cardinality footgun for apps with many ad-hoc
+// queries; hashing it down to a fingerprint of at most 16 hex digits bounds
+// that.
+func New() *Observer {
+	return &Observer{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "golib",
+			Subsystem: "sqlutils",
+			Name:      "query_duration_seconds",
+			Help:      "Duration of SQL queries executed through sqlutils.",
+		}, []string{"driver", "query_fingerprint"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "golib",
+			Subsystem: "sqlutils",
+			Name:      "query_errors_total",
+			Help:      "Count of SQL queries executed through sqlutils that returned an error.",
+		}, []string{"driver", "query_fingerprint"}),
+	}
+}
+
+// queryFingerprint hashes a literal-redacted query down to a hex string of at
+// most 16 characters (leading zeros are dropped), so it's safe to use as a Prometheus label value regardless of how
+// many distinct query shapes the application runs.
+func queryFingerprint(query string) string {
+	h := fnv.New64a()
+	h.Write([]byte(query))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// Describe implements prometheus.Collector.
+func (this *Observer) Describe(ch chan<- *prometheus.Desc) {
+	this.duration.Describe(ch)
+	this.errors.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (this *Observer) Collect(ch chan<- prometheus.Metric) {
+	this.duration.Collect(ch)
+	this.errors.Collect(ch)
+}
+
+// OnQueryStart implements sqlutils.Observer.
+func (this *Observer) OnQueryStart(ctx context.Context, query string) context.Context {
+	return ctx
+}
+
+// OnQueryEnd implements sqlutils.Observer.
+func (this *Observer) OnQueryEnd(ctx context.Context, query string, rowsAffected int64, err error) {
+	driverName, _ := sqlutils.QueryDriverName(ctx)
+
+	var duration time.Duration
+	if startedAt, ok := sqlutils.QueryStartedAt(ctx); ok {
+		duration = time.Since(startedAt)
+	}
+	fingerprint := queryFingerprint(query)
+	this.duration.WithLabelValues(driverName, fingerprint).Observe(duration.Seconds())
+	if err != nil {
+		this.errors.WithLabelValues(driverName, fingerprint).Inc()
+	}
+}
@@ -0,0 +1,42 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package prometheus
+
+import "testing"
+
+func TestQueryFingerprintIsStable(t *testing.T) {
+	a := queryFingerprint("select * from t where id = ?")
+	b := queryFingerprint("select * from t where id = ?")
+	if a != b {
+		t.Fatalf("expected the same query to produce the same fingerprint, got %q and %q", a, b)
+	}
+}
+
+func TestQueryFingerprintDiffersByQuery(t *testing.T) {
+	a := queryFingerprint("select * from t where id = ?")
+	b := queryFingerprint("select * from other where id = ?")
+	if a == b {
+		t.Fatalf("expected different queries to produce different fingerprints")
+	}
+}
+
+func TestQueryFingerprintIsBoundedLength(t *testing.T) {
+	fp := queryFingerprint("select * from t where id = ?")
+	if len(fp) > 16 {
+		t.Fatalf("expected a fingerprint of at most 16 chars, got %d chars: %q", len(fp), fp)
+	}
+}
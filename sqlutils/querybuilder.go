@@ -0,0 +1,215 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package sqlutils
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// ExpandIn rewrites query, replacing each `?` placeholder whose
+// corresponding argument is a slice (other than []byte) with one `?` per
+// slice element, comma-separated, and flattens the slice into the returned
+// argument list in order. Placeholders inside quoted string literals are
+// left untouched. A placeholder bound to an empty slice is rewritten to the
+// literal `NULL`, since `IN ()` is invalid SQL and `IN (NULL)` never
+// matches.
+func ExpandIn(query string, args ...interface{}) (string, []interface{}, error) {
+	var out strings.Builder
+	var outArgs []interface{}
+	argIndex := 0
+	var quote byte
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if quote != 0 {
+			out.WriteByte(c)
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+			out.WriteByte(c)
+		case '?':
+			if argIndex >= len(args) {
+				return "", nil, fmt.Errorf("sqlutils: ExpandIn: not enough arguments for placeholders in query")
+			}
+			arg := args[argIndex]
+			argIndex++
+
+			if n, elems, ok := sliceElements(arg); ok {
+				if n == 0 {
+					out.WriteString("NULL")
+				} else {
+					for j := 0; j < n; j++ {
+						if j > 0 {
+							out.WriteByte(',')
+						}
+						out.WriteByte('?')
+						outArgs = append(outArgs, elems(j))
+					}
+				}
+			} else {
+				out.WriteByte('?')
+				outArgs = append(outArgs, arg)
+			}
+		default:
+			out.WriteByte(c)
+		}
+	}
+	if argIndex != len(args) {
+		return "", nil, fmt.Errorf("sqlutils: ExpandIn: too many arguments for placeholders in query")
+	}
+	return out.String(), outArgs, nil
+}
+
+// sliceElements reports whether arg is a slice that should be expanded
+// ([]byte is treated as an opaque scalar value, not expanded), returning its
+// length and an accessor for its elements as interface{}.
+func sliceElements(arg interface{}) (n int, elem func(i int) interface{}, ok bool) {
+	if arg == nil {
+		return 0, nil, false
+	}
+	rv := reflect.ValueOf(arg)
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return 0, nil, false
+	}
+	return rv.Len(), func(i int) interface{} { return rv.Index(i).Interface() }, true
+}
+
+// emptyInClause matches a WHERE fragment that is exactly a single
+// "... IN (?)" condition, so Builder can special-case it to an always-false
+// predicate instead of relying on ExpandIn's `IN (NULL)` fallback.
+var emptyInClause = regexp.MustCompile(`(?i)^\s*[A-Za-z_][\w.]*\s+IN\s*\(\s*\?\s*\)\s*$`)
+
+func isEmptyInClause(cond string, args []interface{}) bool {
+	if len(args) != 1 {
+		return false
+	}
+	if !emptyInClause.MatchString(strings.TrimSpace(cond)) {
+		return false
+	}
+	n, _, ok := sliceElements(args[0])
+	return ok && n == 0
+}
+
+// whereClause is one AND-joined predicate passed to Builder.Where.
+type whereClause struct {
+	cond string
+	args []interface{}
+}
+
+// Builder is a small fluent SELECT statement builder. It exists to make
+// `IN (?)` slice expansion and driver-appropriate placeholder rebinding
+// (via Rebind) available without hand-rolling query string concatenation.
+type Builder struct {
+	table    string
+	columns  []string
+	wheres   []whereClause
+	orderBy  []string
+	limit    int
+	hasLimit bool
+	bindType BindType
+}
+
+// Select starts a new Builder selecting the given columns. No columns means
+// "select *".
+func Select(columns ...string) *Builder {
+	return &Builder{columns: columns}
+}
+
+// From sets the table to select from.
+func (this *Builder) From(table string) *Builder {
+	this.table = table
+	return this
+}
+
+// Where adds an AND-joined predicate. cond may contain `?` placeholders;
+// a slice-valued arg expands to one placeholder per element, and an
+// empty-slice arg to a condition of the form `x IN (?)` collapses the whole
+// predicate to an always-false `1=0` rather than the invalid `x IN ()`.
+func (this *Builder) Where(cond string, args ...interface{}) *Builder {
+	this.wheres = append(this.wheres, whereClause{cond: cond, args: args})
+	return this
+}
+
+// OrderBy appends columns to the ORDER BY clause, in the order given.
+func (this *Builder) OrderBy(columns ...string) *Builder {
+	this.orderBy = append(this.orderBy, columns...)
+	return this
+}
+
+// Limit sets a LIMIT clause.
+func (this *Builder) Limit(n int) *Builder {
+	this.limit = n
+	this.hasLimit = true
+	return this
+}
+
+// Bind sets the placeholder style Build rebinds the final query to. The
+// default, Question, leaves `?` placeholders as-is.
+func (this *Builder) Bind(bindType BindType) *Builder {
+	this.bindType = bindType
+	return this
+}
+
+// Build renders the statement and its flattened argument list, in the bind
+// type set via Bind (Question, i.e. `?`, by default).
+func (this *Builder) Build() (string, []interface{}, error) {
+	columns := "*"
+	if len(this.columns) > 0 {
+		columns = strings.Join(this.columns, ", ")
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "SELECT %s FROM %s", columns, this.table)
+
+	var args []interface{}
+	for i, w := range this.wheres {
+		if i == 0 {
+			sb.WriteString(" WHERE ")
+		} else {
+			sb.WriteString(" AND ")
+		}
+
+		if isEmptyInClause(w.cond, w.args) {
+			sb.WriteString("1=0")
+			continue
+		}
+		cond, condArgs, err := ExpandIn(w.cond, w.args...)
+		if err != nil {
+			return "", nil, err
+		}
+		sb.WriteString(cond)
+		args = append(args, condArgs...)
+	}
+
+	if len(this.orderBy) > 0 {
+		sb.WriteString(" ORDER BY ")
+		sb.WriteString(strings.Join(this.orderBy, ", "))
+	}
+	if this.hasLimit {
+		fmt.Fprintf(&sb, " LIMIT %d", this.limit)
+	}
+
+	return Rebind(this.bindType, sb.String()), args, nil
+}
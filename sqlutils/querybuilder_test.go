@@ -0,0 +1,161 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package sqlutils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandInScalarUnchanged(t *testing.T) {
+	query, args, err := ExpandIn("select * from t where id = ?", 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if query != "select * from t where id = ?" {
+		t.Fatalf("unexpected query: %s", query)
+	}
+	if len(args) != 1 || args[0] != 5 {
+		t.Fatalf("unexpected args: %+v", args)
+	}
+}
+
+func TestExpandInSliceExpansion(t *testing.T) {
+	query, args, err := ExpandIn("select * from t where id in (?) and name = ?", []int{1, 2, 3}, "bob")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if query != "select * from t where id in (?,?,?) and name = ?" {
+		t.Fatalf("unexpected query: %s", query)
+	}
+	if len(args) != 4 {
+		t.Fatalf("unexpected args: %+v", args)
+	}
+	for i, want := range []interface{}{1, 2, 3, "bob"} {
+		if args[i] != want {
+			t.Fatalf("arg %d: got %+v, want %+v", i, args[i], want)
+		}
+	}
+}
+
+func TestExpandInEmptySliceBecomesNull(t *testing.T) {
+	query, args, err := ExpandIn("select * from t where id in (?)", []int{})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if query != "select * from t where id in (NULL)" {
+		t.Fatalf("unexpected query: %s", query)
+	}
+	if len(args) != 0 {
+		t.Fatalf("expected no args, got %+v", args)
+	}
+}
+
+func TestExpandInByteSliceNotExpanded(t *testing.T) {
+	query, args, err := ExpandIn("select * from t where blob = ?", []byte("hello,world"))
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if query != "select * from t where blob = ?" {
+		t.Fatalf("unexpected query: %s", query)
+	}
+	if len(args) != 1 {
+		t.Fatalf("unexpected args: %+v", args)
+	}
+}
+
+func TestExpandInIgnoresPlaceholdersInQuotedLiterals(t *testing.T) {
+	query, args, err := ExpandIn("select * from t where note = '?' and id in (?)", []int{1, 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if query != "select * from t where note = '?' and id in (?,?)" {
+		t.Fatalf("unexpected query: %s", query)
+	}
+	if len(args) != 2 {
+		t.Fatalf("unexpected args: %+v", args)
+	}
+}
+
+func TestExpandInArgCountMismatch(t *testing.T) {
+	if _, _, err := ExpandIn("select * from t where id = ?"); err == nil {
+		t.Fatal("expected an error for too few arguments")
+	}
+	if _, _, err := ExpandIn("select * from t where 1=1", 5); err == nil {
+		t.Fatal("expected an error for too many arguments")
+	}
+}
+
+// TestExpandInDoesNotCorruptCommaContainingValues guards against the bug
+// InClauseStringValues used to have, where each comma inside a string value
+// was rewritten to two single quotes rather than the value being passed
+// through unchanged as a single bound value.
+func TestExpandInDoesNotCorruptCommaContainingValues(t *testing.T) {
+	query, args, err := ExpandIn("select * from t where name in (?)", []string{"o'brien, jr", "smith"})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if query != "select * from t where name in (?,?)" {
+		t.Fatalf("unexpected query: %s", query)
+	}
+	if len(args) != 2 || args[0] != "o'brien, jr" || args[1] != "smith" {
+		t.Fatalf("unexpected args: %+v", args)
+	}
+}
+
+func TestBuilderSelectWhereOrderLimit(t *testing.T) {
+	query, args, err := Select("id", "name").From("users").
+		Where("age > ?", 18).
+		Where("id in (?)", []int{1, 2, 3}).
+		OrderBy("id").
+		Limit(10).
+		Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	want := "SELECT id, name FROM users WHERE age > ? AND id in (?,?,?) ORDER BY id LIMIT 10"
+	if query != want {
+		t.Fatalf("got %q, want %q", query, want)
+	}
+	if len(args) != 4 {
+		t.Fatalf("unexpected args: %+v", args)
+	}
+}
+
+func TestBuilderEmptyInProducesAlwaysFalse(t *testing.T) {
+	query, args, err := Select().From("users").Where("id in (?)", []int{}).Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if !strings.Contains(query, "WHERE 1=0") {
+		t.Fatalf("expected an always-false predicate, got %q", query)
+	}
+	if len(args) != 0 {
+		t.Fatalf("expected no args, got %+v", args)
+	}
+}
+
+func TestBuilderRebindsToDollarPlaceholders(t *testing.T) {
+	query, _, err := Select().From("users").Where("id = ?", 1).Where("name = ?", "bob").Bind(Dollar).Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	want := "SELECT * FROM users WHERE id = $1 AND name = $2"
+	if query != want {
+		t.Fatalf("got %q, want %q", query, want)
+	}
+}
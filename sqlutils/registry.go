@@ -0,0 +1,225 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package sqlutils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/openark/golib/log"
+)
+
+// PoolOptions configures the connection pool and placeholder style for a DB
+// registered via DBRegistry.Register.
+type PoolOptions struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+	// Rebind is the placeholder style downstream helpers (Rebind, NamedQuery,
+	// NamedExec) should use for this DB. Zero (Question) is a sane default
+	// for MySQL/SQLite; it is inferred from the driver name otherwise.
+	Rebind BindType
+}
+
+type registryEntry struct {
+	name string
+	db   *sql.DB
+}
+
+// DBRegistry is a named collection of *sql.DB handles, configured with pool
+// limits and watched by an optional background health check that pings each
+// handle and logs the ones that fail; it does not evict, close or reopen a
+// failing handle. Unlike GetGenericDB's cache, registrations are
+// explicit and keyed by a caller-chosen name rather than the DSN.
+type DBRegistry struct {
+	mu      sync.Mutex
+	entries map[string]*registryEntry
+	stopCh  chan struct{}
+	started bool
+	wg      sync.WaitGroup
+}
+
+// NewDBRegistry returns an empty DBRegistry.
+func NewDBRegistry() *DBRegistry {
+	return &DBRegistry{entries: make(map[string]*registryEntry)}
+}
+
+// Register opens a DB for driver/dsn, applies opts' pool limits, and makes it
+// available under name via Get. It is an error to register the same name
+// twice.
+func (this *DBRegistry) Register(name, driver, dsn string, opts PoolOptions) (*sql.DB, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if _, exists := this.entries[name]; exists {
+		return nil, fmt.Errorf("sqlutils: DB %q is already registered", name)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	configurePool(db, opts)
+
+	bindType := bindTypeForDriver(driver)
+	if opts.Rebind != Question {
+		bindType = opts.Rebind
+	}
+	setDBBindType(db, bindType)
+	registerDBDriverName(db, driver)
+
+	this.entries[name] = &registryEntry{name: name, db: db}
+	return db, nil
+}
+
+// RegisterObserver scopes o to only the DB registered under name, rather
+// than every DB (see the package-level RegisterObserver).
+func (this *DBRegistry) RegisterObserver(name string, o Observer) error {
+	db, err := this.Get(name)
+	if err != nil {
+		return err
+	}
+	registerDBObserver(db, o)
+	return nil
+}
+
+func configurePool(db *sql.DB, opts PoolOptions) {
+	if opts.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opts.MaxOpenConns)
+	}
+	if opts.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opts.MaxIdleConns)
+	}
+	if opts.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	}
+	if opts.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(opts.ConnMaxIdleTime)
+	}
+}
+
+// Get returns the DB registered under name, or an error if nothing is
+// registered under that name.
+func (this *DBRegistry) Get(name string) (*sql.DB, error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	entry, exists := this.entries[name]
+	if !exists {
+		return nil, fmt.Errorf("sqlutils: no DB registered under %q", name)
+	}
+	return entry.db, nil
+}
+
+// Ping pings every registered DB and returns the last error encountered, if
+// any.
+func (this *DBRegistry) Ping(ctx context.Context) (err error) {
+	this.mu.Lock()
+	entries := make([]*registryEntry, 0, len(this.entries))
+	for _, entry := range this.entries {
+		entries = append(entries, entry)
+	}
+	this.mu.Unlock()
+
+	for _, entry := range entries {
+		if pingErr := entry.db.PingContext(ctx); pingErr != nil {
+			err = fmt.Errorf("sqlutils: ping %q: %w", entry.name, pingErr)
+		}
+	}
+	return err
+}
+
+// healthCheckPingTimeout bounds how long a single health-check ping may
+// take, so one unreachable DB can't stall the whole sweep.
+const healthCheckPingTimeout = 5 * time.Second
+
+// StartHealthCheck launches a background goroutine that, every interval,
+// pings each registered DB and logs any handle that fails to respond. It
+// deliberately does not close and reopen the handle: database/sql already
+// retries transient connection loss per-connection, and replacing *sql.DB
+// out from under a caller that already holds the pointer from Get would
+// leave them stuck on the closed handle with no way to notice. Call Close
+// to stop it.
+func (this *DBRegistry) StartHealthCheck(ctx context.Context, interval time.Duration) {
+	this.mu.Lock()
+	if this.started {
+		this.mu.Unlock()
+		return
+	}
+	this.started = true
+	this.stopCh = make(chan struct{})
+	this.mu.Unlock()
+
+	this.wg.Add(1)
+	go func() {
+		defer this.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-this.stopCh:
+				return
+			case <-ticker.C:
+				this.checkAndRepair(ctx)
+			}
+		}
+	}()
+}
+
+func (this *DBRegistry) checkAndRepair(ctx context.Context) {
+	this.mu.Lock()
+	entries := make([]*registryEntry, 0, len(this.entries))
+	for _, entry := range this.entries {
+		entries = append(entries, entry)
+	}
+	this.mu.Unlock()
+
+	for _, entry := range entries {
+		checkCtx, cancel := context.WithTimeout(ctx, healthCheckPingTimeout)
+		err := entry.db.PingContext(checkCtx)
+		cancel()
+		if err == nil {
+			continue
+		}
+		log.Errore(fmt.Errorf("sqlutils: DBRegistry health check failed for %q: %w", entry.name, err))
+	}
+}
+
+// Close stops the health-check goroutine, if running, and closes every
+// registered DB, returning the last error encountered, if any.
+func (this *DBRegistry) Close() (err error) {
+	this.mu.Lock()
+	if this.started {
+		close(this.stopCh)
+	}
+	this.mu.Unlock()
+	this.wg.Wait()
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for _, entry := range this.entries {
+		if closeErr := entry.db.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package sqlutils
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeDriver is a minimal database/sql/driver.Driver that never actually
+// connects, just enough for sql.Open to accept it and for DBRegistry's pool
+// configuration to be exercised without a real database.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	return nil, errors.New("sqlutils test: fakeDriver does not support connecting")
+}
+
+func init() {
+	sql.Register("sqlutils-fake", fakeDriver{})
+}
+
+func TestDBRegistryRegisterDuplicateName(t *testing.T) {
+	registry := NewDBRegistry()
+	if _, err := registry.Register("primary", "sqlutils-fake", "", PoolOptions{}); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if _, err := registry.Register("primary", "sqlutils-fake", "", PoolOptions{}); err == nil {
+		t.Fatalf("expected an error registering the same name twice")
+	}
+}
+
+func TestDBRegistryGetUnknownName(t *testing.T) {
+	registry := NewDBRegistry()
+	if _, err := registry.Get("missing"); err == nil {
+		t.Fatalf("expected an error for an unregistered name")
+	}
+}
+
+func TestDBRegistryRegisterAppliesPoolOptions(t *testing.T) {
+	registry := NewDBRegistry()
+	db, err := registry.Register("primary", "sqlutils-fake", "", PoolOptions{
+		MaxOpenConns:    7,
+		MaxIdleConns:    3,
+		ConnMaxLifetime: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if stats := db.Stats(); stats.MaxOpenConnections != 7 {
+		t.Fatalf("expected MaxOpenConnections to be 7, got %d", stats.MaxOpenConnections)
+	}
+}
+
+func TestDBRegistryRegisterSetsRebindFromOptions(t *testing.T) {
+	registry := NewDBRegistry()
+	db, err := registry.Register("primary", "sqlutils-fake", "", PoolOptions{Rebind: Dollar})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if got := bindTypeForDB(db); got != Dollar {
+		t.Fatalf("expected Rebind option to set the DB's bind type to Dollar, got %v", got)
+	}
+}
+
+func TestDBRegistryRegisterDefaultsRebindFromDriver(t *testing.T) {
+	registry := NewDBRegistry()
+	db, err := registry.Register("primary", "sqlutils-fake", "", PoolOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	// sqlutils-fake is unrecognized by bindTypeForDriver, so it should fall
+	// back to Question, same as an unrecognized real driver would.
+	if got := bindTypeForDB(db); got != Question {
+		t.Fatalf("expected an unrecognized driver to default to Question binding, got %v", got)
+	}
+}
+
+func TestDBRegistryGetReturnsRegisteredDB(t *testing.T) {
+	registry := NewDBRegistry()
+	registered, err := registry.Register("primary", "sqlutils-fake", "", PoolOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	got, err := registry.Get("primary")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if got != registered {
+		t.Fatalf("expected Get to return the same *sql.DB returned by Register")
+	}
+}
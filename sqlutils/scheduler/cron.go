@@ -0,0 +1,178 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package scheduler lets callers register recurring SQL jobs on a six-field
+// (seconds-granularity) cron schedule, streaming query-type job results into
+// a user-supplied Sink.
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed six-field cron expression: seconds minutes hours
+// day-of-month month day-of-week.
+type Schedule struct {
+	seconds  map[int]bool
+	minutes  map[int]bool
+	hours    map[int]bool
+	days     map[int]bool
+	months   map[int]bool
+	weekdays map[int]bool
+
+	// daysRestricted and weekdaysRestricted record whether the day-of-month
+	// and day-of-week fields were anything other than "*". Standard cron
+	// semantics OR these two fields together when both are restricted (e.g.
+	// "run on the 1st and 15th, or every Monday"), rather than ANDing them.
+	daysRestricted     bool
+	weekdaysRestricted bool
+}
+
+// ParseSchedule parses a six-field cron expression ("0 */5 * * * *" runs
+// every 5 minutes, on the 0th second). Each field accepts "*", a single
+// value, a range ("1-5"), a step ("*/5" or "1-10/2"), or a comma-separated
+// list of any of those.
+//
+// Following standard cron semantics, if both day-of-month and day-of-week
+// are restricted (anything other than "*"), a time matches when either one
+// matches, rather than requiring both.
+func ParseSchedule(spec string) (*Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("scheduler: cron spec must have 6 fields (seconds minutes hours day month weekday), got %d: %q", len(fields), spec)
+	}
+
+	seconds, err := parseCronField(fields[0], 0, 59)
+	if err != nil {
+		return nil, err
+	}
+	minutes, err := parseCronField(fields[1], 0, 59)
+	if err != nil {
+		return nil, err
+	}
+	hours, err := parseCronField(fields[2], 0, 23)
+	if err != nil {
+		return nil, err
+	}
+	days, err := parseCronField(fields[3], 1, 31)
+	if err != nil {
+		return nil, err
+	}
+	months, err := parseCronField(fields[4], 1, 12)
+	if err != nil {
+		return nil, err
+	}
+	weekdays, err := parseCronField(fields[5], 0, 6)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Schedule{
+		seconds:  seconds,
+		minutes:  minutes,
+		hours:    hours,
+		days:     days,
+		months:   months,
+		weekdays: weekdays,
+
+		daysRestricted:     fields[3] != "*",
+		weekdaysRestricted: fields[5] != "*",
+	}, nil
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		rangePart := part
+		step := 1
+		if slash := strings.IndexByte(part, '/'); slash >= 0 {
+			rangePart = part[:slash]
+			s, err := strconv.Atoi(part[slash+1:])
+			if err != nil || s <= 0 {
+				return nil, fmt.Errorf("scheduler: invalid step in cron field %q", field)
+			}
+			step = s
+		}
+
+		var lo, hi int
+		switch {
+		case rangePart == "*":
+			lo, hi = min, max
+		case strings.Contains(rangePart, "-"):
+			dash := strings.IndexByte(rangePart, '-')
+			var err error
+			if lo, err = strconv.Atoi(rangePart[:dash]); err != nil {
+				return nil, fmt.Errorf("scheduler: invalid range in cron field %q", field)
+			}
+			if hi, err = strconv.Atoi(rangePart[dash+1:]); err != nil {
+				return nil, fmt.Errorf("scheduler: invalid range in cron field %q", field)
+			}
+		default:
+			v, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return nil, fmt.Errorf("scheduler: invalid value in cron field %q", field)
+			}
+			lo, hi = v, v
+		}
+
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("scheduler: cron field %q out of range [%d,%d]", field, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+func (this *Schedule) matches(t time.Time) bool {
+	dayOfMonthMatches := this.days[t.Day()]
+	weekdayMatches := this.weekdays[int(t.Weekday())]
+	var dayMatches bool
+	if this.daysRestricted && this.weekdaysRestricted {
+		dayMatches = dayOfMonthMatches || weekdayMatches
+	} else {
+		dayMatches = dayOfMonthMatches && weekdayMatches
+	}
+
+	return this.seconds[t.Second()] &&
+		this.minutes[t.Minute()] &&
+		this.hours[t.Hour()] &&
+		this.months[int(t.Month())] &&
+		dayMatches
+}
+
+// maxScheduleSearch bounds how far into the future Next will look before
+// giving up on finding a matching time (guards against cron specs whose
+// fields can never all match, e.g. Feb 30th).
+const maxScheduleSearch = 4 * 365 * 24 * time.Hour
+
+// Next returns the first time strictly after `after` that matches this
+// schedule, at one-second resolution.
+func (this *Schedule) Next(after time.Time) (time.Time, error) {
+	t := after.Truncate(time.Second).Add(time.Second)
+	deadline := after.Add(maxScheduleSearch)
+	for t.Before(deadline) {
+		if this.matches(t) {
+			return t, nil
+		}
+		t = t.Add(time.Second)
+	}
+	return time.Time{}, fmt.Errorf("scheduler: no time matches cron schedule within %s", maxScheduleSearch)
+}
@@ -0,0 +1,102 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleRejectsWrongFieldCount(t *testing.T) {
+	if _, err := ParseSchedule("* * * *"); err == nil {
+		t.Fatalf("expected an error for a four-field spec")
+	}
+}
+
+func TestScheduleMatchesEveryFiveMinutes(t *testing.T) {
+	sched, err := ParseSchedule("0 */5 * * * *")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	match := time.Date(2026, 7, 29, 10, 10, 0, 0, time.UTC)
+	if !sched.matches(match) {
+		t.Fatalf("expected %s to match", match)
+	}
+	noMatch := time.Date(2026, 7, 29, 10, 11, 0, 0, time.UTC)
+	if sched.matches(noMatch) {
+		t.Fatalf("expected %s not to match", noMatch)
+	}
+}
+
+func TestScheduleMatchesOrsDayOfMonthAndWeekdayWhenBothRestricted(t *testing.T) {
+	// "1st or 15th of the month, OR every Monday" at midnight.
+	sched, err := ParseSchedule("0 0 0 1,15 * 1")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	// 2026-07-29 is a Wednesday and not the 1st/15th: neither side matches.
+	notMatched := time.Date(2026, 7, 29, 0, 0, 0, 0, time.UTC)
+	if sched.matches(notMatched) {
+		t.Fatalf("expected %s not to match", notMatched)
+	}
+
+	// 2026-07-15 is a Wednesday but is the 15th: day-of-month side matches.
+	dayOfMonthMatch := time.Date(2026, 7, 15, 0, 0, 0, 0, time.UTC)
+	if !sched.matches(dayOfMonthMatch) {
+		t.Fatalf("expected %s to match via day-of-month", dayOfMonthMatch)
+	}
+
+	// 2026-07-27 is a Monday but not the 1st/15th: weekday side matches.
+	weekdayMatch := time.Date(2026, 7, 27, 0, 0, 0, 0, time.UTC)
+	if !sched.matches(weekdayMatch) {
+		t.Fatalf("expected %s to match via weekday", weekdayMatch)
+	}
+}
+
+func TestScheduleAndsDayOfMonthAndWeekdayWhenOnlyOneRestricted(t *testing.T) {
+	// Weekday left as "*": only day-of-month restricts, so this behaves as
+	// a plain AND (every field must match, and "*" always matches).
+	sched, err := ParseSchedule("0 0 0 15 * *")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	match := time.Date(2026, 7, 15, 0, 0, 0, 0, time.UTC)
+	if !sched.matches(match) {
+		t.Fatalf("expected %s to match", match)
+	}
+	notMatch := time.Date(2026, 7, 16, 0, 0, 0, 0, time.UTC)
+	if sched.matches(notMatch) {
+		t.Fatalf("expected %s not to match", notMatch)
+	}
+}
+
+func TestScheduleNextFindsNextMatchingSecond(t *testing.T) {
+	sched, err := ParseSchedule("30 * * * * *")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	after := time.Date(2026, 7, 29, 10, 0, 0, 0, time.UTC)
+	next, err := sched.Next(after)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	want := time.Date(2026, 7, 29, 10, 0, 30, 0, time.UTC)
+	if !next.Equal(want) {
+		t.Fatalf("got %s, want %s", next, want)
+	}
+}
@@ -0,0 +1,227 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/openark/golib/log"
+	"github.com/ylacancellera/golib/sqlutils"
+)
+
+// ArgsFunc supplies the query arguments for a job's next run, evaluated
+// fresh on every execution (e.g. to bind the current time).
+type ArgsFunc func() []interface{}
+
+// kind distinguishes an Exec-type job from a Query-type job.
+type kind int
+
+const (
+	execJob kind = iota
+	queryJob
+)
+
+// Metrics is a snapshot of a job's last execution.
+type Metrics struct {
+	LastRun      time.Time
+	LastDuration time.Duration
+	RowsAffected int64
+	LastErr      error
+}
+
+// job is a single registered, scheduled unit of work.
+type job struct {
+	name     string
+	schedule *Schedule
+	kind     kind
+	query    string
+	argsFn   ArgsFunc
+	sink     Sink
+
+	mu      sync.Mutex
+	metrics Metrics
+}
+
+func (this *job) recordRun(start time.Time, rowsAffected int64, err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	this.metrics = Metrics{
+		LastRun:      start,
+		LastDuration: time.Since(start),
+		RowsAffected: rowsAffected,
+		LastErr:      err,
+	}
+}
+
+func (this *job) snapshot() Metrics {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	return this.metrics
+}
+
+// Scheduler runs registered jobs against a single *sql.DB on their own cron
+// schedules, until Stop is called.
+type Scheduler struct {
+	db *sql.DB
+
+	mu     sync.Mutex
+	jobs   map[string]*job
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a Scheduler that runs jobs against db.
+func New(db *sql.DB) *Scheduler {
+	return &Scheduler{db: db, jobs: make(map[string]*job)}
+}
+
+// RegisterJob registers an Exec-type job: on every trigger of cronSpec, query
+// is executed (with argsFn's result as bind arguments, if non-nil) via
+// sqlutils.ExecContext.
+func (this *Scheduler) RegisterJob(name, cronSpec, query string, argsFn ArgsFunc) error {
+	return this.register(name, cronSpec, query, argsFn, execJob, nil)
+}
+
+// RegisterQueryJob registers a Query-type job: on every trigger of cronSpec,
+// query is run (with argsFn's result as bind arguments, if non-nil) and each
+// resulting row is handed to sink.
+func (this *Scheduler) RegisterQueryJob(name, cronSpec, query string, argsFn ArgsFunc, sink Sink) error {
+	if sink == nil {
+		return fmt.Errorf("scheduler: RegisterQueryJob %q: sink must not be nil", name)
+	}
+	return this.register(name, cronSpec, query, argsFn, queryJob, sink)
+}
+
+func (this *Scheduler) register(name, cronSpec, query string, argsFn ArgsFunc, k kind, sink Sink) error {
+	schedule, err := ParseSchedule(cronSpec)
+	if err != nil {
+		return err
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if _, exists := this.jobs[name]; exists {
+		return fmt.Errorf("scheduler: job %q is already registered", name)
+	}
+	this.jobs[name] = &job{name: name, schedule: schedule, kind: k, query: query, argsFn: argsFn, sink: sink}
+	return nil
+}
+
+// Start launches one goroutine per registered job, each sleeping until its
+// next scheduled run. It returns immediately; jobs run until ctx is
+// cancelled or Stop is called.
+func (this *Scheduler) Start(ctx context.Context) {
+	runCtx, cancel := context.WithCancel(ctx)
+
+	this.mu.Lock()
+	this.cancel = cancel
+	jobs := make([]*job, 0, len(this.jobs))
+	for _, j := range this.jobs {
+		jobs = append(jobs, j)
+	}
+	this.mu.Unlock()
+
+	for _, j := range jobs {
+		this.wg.Add(1)
+		go this.runLoop(runCtx, j)
+	}
+}
+
+func (this *Scheduler) runLoop(ctx context.Context, j *job) {
+	defer this.wg.Done()
+	for {
+		next, err := j.schedule.Next(time.Now())
+		if err != nil {
+			log.Errore(fmt.Errorf("scheduler: job %q: %w", j.name, err))
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(next)):
+			this.run(ctx, j)
+		}
+	}
+}
+
+// Stop cancels all running job loops and waits for them to return.
+func (this *Scheduler) Stop() {
+	this.mu.Lock()
+	cancel := this.cancel
+	this.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	this.wg.Wait()
+}
+
+// RunNow executes the named job immediately, out of band from its schedule,
+// and returns any error from that run.
+func (this *Scheduler) RunNow(name string) error {
+	this.mu.Lock()
+	j, exists := this.jobs[name]
+	this.mu.Unlock()
+	if !exists {
+		return fmt.Errorf("scheduler: no job registered under %q", name)
+	}
+	this.run(context.Background(), j)
+	return j.snapshot().LastErr
+}
+
+// Metrics returns the last-run metrics for the named job.
+func (this *Scheduler) Metrics(name string) (Metrics, error) {
+	this.mu.Lock()
+	j, exists := this.jobs[name]
+	this.mu.Unlock()
+	if !exists {
+		return Metrics{}, fmt.Errorf("scheduler: no job registered under %q", name)
+	}
+	return j.snapshot(), nil
+}
+
+func (this *Scheduler) run(ctx context.Context, j *job) {
+	start := time.Now()
+	var args []interface{}
+	if j.argsFn != nil {
+		args = j.argsFn()
+	}
+
+	var rowsAffected int64
+	var runErr error
+	switch j.kind {
+	case execJob:
+		var res sql.Result
+		res, runErr = sqlutils.ExecContext(ctx, this.db, j.query, args...)
+		if runErr == nil && res != nil {
+			rowsAffected, _ = res.RowsAffected()
+		}
+	case queryJob:
+		runErr = sqlutils.QueryRowsMapContext(ctx, this.db, j.query, func(row sqlutils.RowMap) error {
+			rowsAffected++
+			return j.sink.WriteRow(row)
+		}, args...)
+	}
+
+	j.recordRun(start, rowsAffected, runErr)
+	if runErr != nil {
+		log.Errore(fmt.Errorf("scheduler: job %q: %w", j.name, runErr))
+	}
+}
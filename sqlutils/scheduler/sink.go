@@ -0,0 +1,80 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ylacancellera/golib/sqlutils"
+)
+
+// Sink receives one row at a time from a query-type job.
+type Sink interface {
+	WriteRow(row sqlutils.RowMap) error
+}
+
+// SinkFunc adapts a plain function to a Sink.
+type SinkFunc func(row sqlutils.RowMap) error
+
+func (this SinkFunc) WriteRow(row sqlutils.RowMap) error {
+	return this(row)
+}
+
+// ChannelSink is a Sink that forwards every row onto a channel. WriteRow
+// blocks while the channel's buffer is full or, for an unbuffered channel,
+// until a reader receives the row.
+type ChannelSink chan sqlutils.RowMap
+
+func (this ChannelSink) WriteRow(row sqlutils.RowMap) error {
+	this <- row
+	return nil
+}
+
+// TableSink is a Sink that writes every row into Table on DB, via a
+// "replace into" statement built from the row's columns, mirroring
+// sqlutils.WriteTableContext.
+type TableSink struct {
+	DB    *sql.DB
+	Table string
+}
+
+func (this *TableSink) WriteRow(row sqlutils.RowMap) error {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	placeholders := make([]string, len(columns))
+	args := make([]interface{}, len(columns))
+	for i, column := range columns {
+		placeholders[i] = "?"
+		cell := row[column]
+		args[i] = cell.NullString()
+	}
+	query := fmt.Sprintf(
+		"replace into %s (%s) values (%s)",
+		this.Table,
+		strings.Join(columns, ","),
+		strings.Join(placeholders, ","),
+	)
+	_, err := this.DB.Exec(query, args...)
+	return err
+}
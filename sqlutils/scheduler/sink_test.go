@@ -0,0 +1,54 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/ylacancellera/golib/sqlutils"
+)
+
+func TestChannelSinkForwardsRow(t *testing.T) {
+	ch := make(ChannelSink, 1)
+	row := sqlutils.RowMap{"id": sqlutils.CellData{Valid: true, String: "5"}}
+	if err := ch.WriteRow(row); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	select {
+	case got := <-ch:
+		if got["id"].String != "5" {
+			t.Fatalf("unexpected row: %+v", got)
+		}
+	default:
+		t.Fatalf("expected a row on the channel")
+	}
+}
+
+func TestSinkFuncAdapts(t *testing.T) {
+	var got sqlutils.RowMap
+	fn := SinkFunc(func(row sqlutils.RowMap) error {
+		got = row
+		return nil
+	})
+	row := sqlutils.RowMap{"id": sqlutils.CellData{Valid: true, String: "9"}}
+	if err := fn.WriteRow(row); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if got["id"].String != "9" {
+		t.Fatalf("unexpected row: %+v", got)
+	}
+}
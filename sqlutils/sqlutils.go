@@ -185,6 +185,8 @@ func GetGenericDB(driverName, dataSourceName string) (*sql.DB, bool, error) {
 	if _, exists = knownDBs[dataSourceName]; !exists {
 		if db, err := sql.Open(driverName, dataSourceName); err == nil {
 			knownDBs[dataSourceName] = db
+			registerDBBindType(db, driverName)
+			registerDBDriverName(db, driverName)
 		} else {
 			return db, exists, err
 		}
@@ -204,6 +206,18 @@ func GetSQLiteDB(dbFile string) (*sql.DB, bool, error) {
 	return GetGenericDB("sqlite3", dbFile)
 }
 
+// GetPostgresDB returns a Postgres DB instance based on uri.
+// bool result indicates whether the DB was returned from cache; err
+func GetPostgresDB(postgres_uri string) (*sql.DB, bool, error) {
+	return GetGenericDB("postgres", postgres_uri)
+}
+
+// GetSQLServerDB returns a SQL Server DB instance based on uri.
+// bool result indicates whether the DB was returned from cache; err
+func GetSQLServerDB(sqlserver_uri string) (*sql.DB, bool, error) {
+	return GetGenericDB("sqlserver", sqlserver_uri)
+}
+
 // RowToArray is a convenience function, typically not called directly, which maps a
 // single read database row into a NullString
 func RowToArray(rows *sql.Rows, columns []string) []CellData {
@@ -262,15 +276,22 @@ func QueryRowsMapContext(ctx context.Context, db *sql.DB, query string, on_row f
 		}
 	}()
 
-	var rows *sql.Rows
-	rows, err = db.QueryContext(ctx, query, args...)
-	if rows != nil {
-		defer rows.Close()
-	}
-	if err != nil && err != sql.ErrNoRows {
-		return log.Errore(err)
-	}
-	err = ScanRowsToMaps(rows, on_row)
+	var rowCount int64
+	_, err = observeQuery(ctx, db, query, func(obsCtx context.Context) (int64, error) {
+		var rows *sql.Rows
+		rows, err = db.QueryContext(obsCtx, query, args...)
+		if rows != nil {
+			defer rows.Close()
+		}
+		if err != nil && err != sql.ErrNoRows {
+			return rowCount, log.Errore(err)
+		}
+		err = ScanRowsToMaps(rows, func(row RowMap) error {
+			rowCount++
+			return on_row(row)
+		})
+		return rowCount, err
+	})
 	return
 }
 
@@ -288,20 +309,24 @@ func queryResultDataContext(ctx context.Context, db *sql.DB, query string, retri
 		}
 	}()
 
-	var rows *sql.Rows
-	rows, err = db.QueryContext(ctx, query, args...)
-	defer rows.Close()
-	if err != nil && err != sql.ErrNoRows {
-		return EmptyResultData, columns, err
-	}
-	if retrieveColumns {
-		// Don't pay if you don't want to
-		columns, _ = rows.Columns()
-	}
-	resultData = ResultData{}
-	err = ScanRowsToArrays(rows, func(rowData []CellData) error {
-		resultData = append(resultData, rowData)
-		return nil
+	_, err = observeQuery(ctx, db, query, func(obsCtx context.Context) (int64, error) {
+		var rows *sql.Rows
+		rows, err = db.QueryContext(obsCtx, query, args...)
+		defer rows.Close()
+		if err != nil && err != sql.ErrNoRows {
+			resultData = EmptyResultData
+			return 0, err
+		}
+		if retrieveColumns {
+			// Don't pay if you don't want to
+			columns, _ = rows.Columns()
+		}
+		resultData = ResultData{}
+		err = ScanRowsToArrays(rows, func(rowData []CellData) error {
+			resultData = append(resultData, rowData)
+			return nil
+		})
+		return int64(len(resultData)), err
 	})
 	return resultData, columns, err
 }
@@ -368,7 +393,14 @@ func ExecNoPrepareContext(ctx context.Context, db *sql.DB, query string, args ..
 		}
 	}()
 
-	res, err = db.ExecContext(ctx, query, args...)
+	_, err = observeQuery(ctx, db, query, func(obsCtx context.Context) (int64, error) {
+		res, err = db.ExecContext(obsCtx, query, args...)
+		var rowsAffected int64
+		if err == nil && res != nil {
+			rowsAffected, _ = res.RowsAffected()
+		}
+		return rowsAffected, err
+	})
 	if err != nil {
 		log.Errore(err)
 	}
@@ -394,7 +426,14 @@ func execInternalContext(ctx context.Context, silent bool, db *sql.DB, query str
 		return nil, err
 	}
 	defer stmt.Close()
-	res, err = stmt.ExecContext(ctx, args...)
+	_, err = observeQuery(ctx, db, query, func(obsCtx context.Context) (int64, error) {
+		res, err = stmt.ExecContext(obsCtx, args...)
+		var rowsAffected int64
+		if err == nil && res != nil {
+			rowsAffected, _ = res.RowsAffected()
+		}
+		return rowsAffected, err
+	})
 	if err != nil && !silent {
 		log.Errore(err)
 	}
@@ -429,14 +468,6 @@ func ExecSilently(db *sql.DB, query string, args ...interface{}) (sql.Result, er
 	return execInternal(true, db, query, args...)
 }
 
-func InClauseStringValues(terms []string) string {
-	quoted := []string{}
-	for _, s := range terms {
-		quoted = append(quoted, fmt.Sprintf("'%s'", strings.Replace(s, ",", "''", -1)))
-	}
-	return strings.Join(quoted, ", ")
-}
-
 // Convert variable length arguments into arguments array
 func Args(args ...interface{}) []interface{} {
 	return args
@@ -0,0 +1,403 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package sqlutils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// BindType identifies the placeholder style a driver expects. Queries written
+// with plain `?` placeholders are rebound to the right style via Rebind.
+type BindType int
+
+const (
+	Question BindType = iota
+	Dollar
+	Named
+	At
+)
+
+// bindTypeForDriver returns the placeholder style commonly used by the given
+// database/sql driver name. Unrecognized drivers default to Question, which
+// is a no-op for Rebind.
+func bindTypeForDriver(driverName string) BindType {
+	switch driverName {
+	case "postgres", "pgx", "pq-timeouts", "cloudsqlpostgres":
+		return Dollar
+	case "oci8", "ora", "goracle", "godror":
+		return Named
+	case "mssql", "sqlserver":
+		return At
+	default:
+		return Question
+	}
+}
+
+// knownDBBindTypes remembers the bind type a *sql.DB was opened with, so that
+// NamedQuery/NamedExec can rebind `:name` queries without requiring callers
+// to pass the bind type on every call.
+var knownDBBindTypes = make(map[*sql.DB]BindType)
+var knownDBBindTypesMutex = &sync.Mutex{}
+
+func registerDBBindType(db *sql.DB, driverName string) {
+	knownDBBindTypesMutex.Lock()
+	defer knownDBBindTypesMutex.Unlock()
+	knownDBBindTypes[db] = bindTypeForDriver(driverName)
+}
+
+func bindTypeForDB(db *sql.DB) BindType {
+	knownDBBindTypesMutex.Lock()
+	defer knownDBBindTypesMutex.Unlock()
+	return knownDBBindTypes[db]
+}
+
+// setDBBindType explicitly records the bind type to use for db, overriding
+// whatever bindTypeForDriver would have inferred. Used by DBRegistry, whose
+// PoolOptions.Rebind lets callers pick the bind type explicitly.
+func setDBBindType(db *sql.DB, bindType BindType) {
+	knownDBBindTypesMutex.Lock()
+	defer knownDBBindTypesMutex.Unlock()
+	knownDBBindTypes[db] = bindType
+}
+
+// Rebind translates a query written with `?` placeholders into the
+// placeholder style used by bindType, e.g. `$1`, `:arg1` or `@p1`. Question
+// is returned unchanged. Placeholders inside single- or double-quoted string
+// literals are left untouched.
+func Rebind(bindType BindType, query string) string {
+	if bindType == Question {
+		return query
+	}
+
+	var out strings.Builder
+	argNum := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if quote != 0 {
+			out.WriteByte(c)
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+			out.WriteByte(c)
+		case '?':
+			argNum++
+			switch bindType {
+			case Dollar:
+				fmt.Fprintf(&out, "$%d", argNum)
+			case Named:
+				fmt.Fprintf(&out, ":arg%d", argNum)
+			case At:
+				fmt.Fprintf(&out, "@p%d", argNum)
+			default:
+				out.WriteByte(c)
+			}
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+// typeFieldsCache memoizes the "db" tag -> struct field index mapping for a
+// given reflect.Type so repeated scans don't pay the reflection cost.
+var typeFieldsCache sync.Map // map[reflect.Type]map[string][]int
+
+// typeFields returns a mapping of lower-cased column name (honoring `db`
+// struct tags, defaulting to the lower-cased field name) to the field's index
+// path. Anonymous (embedded) struct fields are flattened into the parent, so
+// their columns are addressable as if declared directly.
+func typeFields(t reflect.Type) map[string][]int {
+	if cached, ok := typeFieldsCache.Load(t); ok {
+		return cached.(map[string][]int)
+	}
+
+	fields := make(map[string][]int)
+	var walk func(t reflect.Type, index []int)
+	walk = func(t reflect.Type, index []int) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" && !f.Anonymous {
+				// unexported field
+				continue
+			}
+			tag := f.Tag.Get("db")
+			if tag == "-" {
+				continue
+			}
+			idx := make([]int, len(index)+1)
+			copy(idx, index)
+			idx[len(index)] = i
+
+			if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+				walk(f.Type, idx)
+				continue
+			}
+
+			name := tag
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			fields[strings.ToLower(name)] = idx
+		}
+	}
+	walk(t, nil)
+
+	typeFieldsCache.Store(t, fields)
+	return fields
+}
+
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for _, i := range index {
+		v = v.Field(i)
+	}
+	return v
+}
+
+// ScanStruct scans the current row of rows into dest, which must be a
+// pointer to a struct. Columns are matched to fields via `db:"col"` tags,
+// falling back to the lower-cased field name; unmatched columns are
+// discarded. Fields implementing sql.Scanner, and pointer fields for
+// nullable columns, are supported as-is by database/sql.
+func ScanStruct(rows *sql.Rows, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("sqlutils: ScanStruct expects a pointer to a struct, got %T", dest)
+	}
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	fields := typeFields(v.Elem().Type())
+
+	scanDest := make([]interface{}, len(columns))
+	for i, col := range columns {
+		idx, ok := fields[strings.ToLower(col)]
+		if !ok {
+			var ignored interface{}
+			scanDest[i] = &ignored
+			continue
+		}
+		scanDest[i] = fieldByIndex(v.Elem(), idx).Addr().Interface()
+	}
+	return rows.Scan(scanDest...)
+}
+
+// GetStruct runs query and scans the single resulting row into dest, which
+// must be a pointer to a struct. It returns sql.ErrNoRows if the query
+// produced no rows, mirroring the rest of this package's single-row helpers.
+func GetStruct(ctx context.Context, db *sql.DB, dest interface{}, query string, args ...interface{}) error {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	if err := ScanStruct(rows, dest); err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// SelectStructs runs query and appends one struct per resulting row into
+// dest, which must be a pointer to a slice of struct or pointer-to-struct.
+func SelectStructs(ctx context.Context, db *sql.DB, dest interface{}, query string, args ...interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("sqlutils: SelectStructs expects a pointer to a slice, got %T", dest)
+	}
+	sliceVal := v.Elem()
+	elemType := sliceVal.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	structType := elemType
+	if isPtr {
+		structType = elemType.Elem()
+	}
+	if structType.Kind() != reflect.Struct {
+		return fmt.Errorf("sqlutils: SelectStructs expects a slice of struct or *struct, got %T", dest)
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		elemPtr := reflect.New(structType)
+		if err := ScanStruct(rows, elemPtr.Interface()); err != nil {
+			return err
+		}
+		if isPtr {
+			sliceVal.Set(reflect.Append(sliceVal, elemPtr))
+		} else {
+			sliceVal.Set(reflect.Append(sliceVal, elemPtr.Elem()))
+		}
+	}
+	return rows.Err()
+}
+
+// namedArgGetter looks up a named parameter's value by name, honoring the
+// same `db` tag rules as ScanStruct when arg is a struct. Lookups are
+// case-insensitive for every arg type, including map[string]interface{} and
+// RowMap, so the same `:Name` placeholder behaves the same way regardless of
+// which arg type the caller passes.
+func namedArgGetter(arg interface{}) (func(name string) (interface{}, bool), error) {
+	switch a := arg.(type) {
+	case map[string]interface{}:
+		lowered := make(map[string]interface{}, len(a))
+		for k, v := range a {
+			lowered[strings.ToLower(k)] = v
+		}
+		return func(name string) (interface{}, bool) {
+			v, ok := lowered[strings.ToLower(name)]
+			return v, ok
+		}, nil
+	case RowMap:
+		lowered := make(map[string]CellData, len(a))
+		for k, v := range a {
+			lowered[strings.ToLower(k)] = v
+		}
+		return func(name string) (interface{}, bool) {
+			cell, ok := lowered[strings.ToLower(name)]
+			if !ok {
+				return nil, false
+			}
+			return cell.NullString(), true
+		}, nil
+	}
+
+	v := reflect.ValueOf(arg)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("sqlutils: named parameter argument must be a struct, map[string]interface{} or RowMap, got %T", arg)
+	}
+	fields := typeFields(v.Type())
+	return func(name string) (interface{}, bool) {
+		idx, ok := fields[strings.ToLower(name)]
+		if !ok {
+			return nil, false
+		}
+		return fieldByIndex(v, idx).Interface(), true
+	}, nil
+}
+
+func isNameStartChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStartChar(c) || (c >= '0' && c <= '9')
+}
+
+// compileNamed rewrites `:name` placeholders in query into `?`, returning the
+// rewritten query and the corresponding argument slice, in order.
+func compileNamed(query string, arg interface{}) (string, []interface{}, error) {
+	get, err := namedArgGetter(arg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var out strings.Builder
+	var args []interface{}
+	var quote byte
+	for i := 0; i < len(query); {
+		c := query[i]
+		if quote != 0 {
+			out.WriteByte(c)
+			if c == quote {
+				quote = 0
+			}
+			i++
+			continue
+		}
+		switch c {
+		case '\'', '"', '`':
+			quote = c
+			out.WriteByte(c)
+			i++
+			continue
+		case ':':
+			// A second colon makes this a Postgres-style "::type" cast, not
+			// a named placeholder; pass both through untouched.
+			if i+1 < len(query) && query[i+1] == ':' {
+				out.WriteString("::")
+				i += 2
+				continue
+			}
+			if i+1 < len(query) && isNameStartChar(query[i+1]) {
+				j := i + 1
+				for j < len(query) && isNameChar(query[j]) {
+					j++
+				}
+				name := query[i+1 : j]
+				val, ok := get(name)
+				if !ok {
+					return "", nil, fmt.Errorf("sqlutils: NamedQuery/NamedExec: missing parameter %q", name)
+				}
+				out.WriteByte('?')
+				args = append(args, val)
+				i = j
+				continue
+			}
+		}
+		out.WriteByte(c)
+		i++
+	}
+	return out.String(), args, nil
+}
+
+// NamedQuery runs query against db after rewriting its `:name` placeholders
+// using arg (a struct, a map[string]interface{}, or a RowMap), rebinding the
+// resulting positional placeholders to db's bind type.
+func NamedQuery(ctx context.Context, db *sql.DB, query string, arg interface{}) (*sql.Rows, error) {
+	rebound, args, err := compileNamed(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return db.QueryContext(ctx, Rebind(bindTypeForDB(db), rebound), args...)
+}
+
+// NamedExec executes query against db after rewriting its `:name`
+// placeholders using arg (a struct, a map[string]interface{}, or a RowMap),
+// rebinding the resulting positional placeholders to db's bind type.
+func NamedExec(ctx context.Context, db *sql.DB, query string, arg interface{}) (sql.Result, error) {
+	rebound, args, err := compileNamed(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return db.ExecContext(ctx, Rebind(bindTypeForDB(db), rebound), args...)
+}
@@ -0,0 +1,259 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package sqlutils
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+)
+
+// queryFakeDriver is a minimal database/sql/driver.Driver, registered once
+// below, that returns canned rows/results instead of talking to a real
+// database. It exists so ScanStruct/GetStruct/SelectStructs/NamedQuery/
+// NamedExec can be exercised end to end through *sql.DB.
+type queryFakeDriver struct{}
+
+func (queryFakeDriver) Open(name string) (driver.Conn, error) {
+	return &queryFakeConn{}, nil
+}
+
+func init() {
+	sql.Register("sqlutils-fake-query", queryFakeDriver{})
+}
+
+type queryFakeConn struct{}
+
+func (c *queryFakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("sqlutils test: queryFakeConn does not support Prepare")
+}
+
+func (c *queryFakeConn) Close() error { return nil }
+
+func (c *queryFakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("sqlutils test: queryFakeConn does not support transactions")
+}
+
+func (c *queryFakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	recordFakeCall(query, args)
+	return &fakePersonRows{rows: [][2]interface{}{
+		{int64(1), "alice"},
+		{int64(2), "bob"},
+	}}, nil
+}
+
+func (c *queryFakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	recordFakeCall(query, args)
+	return fakeResult{rowsAffected: 1}, nil
+}
+
+type fakeResult struct{ rowsAffected int64 }
+
+func (r fakeResult) LastInsertId() (int64, error) { return 0, nil }
+func (r fakeResult) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+// fakePersonRows yields a fixed set of (id, name) rows regardless of the
+// query text, enough to drive the scanning/binding logic under test.
+type fakePersonRows struct {
+	rows [][2]interface{}
+	pos  int
+}
+
+func (r *fakePersonRows) Columns() []string { return []string{"id", "name"} }
+func (r *fakePersonRows) Close() error      { return nil }
+func (r *fakePersonRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	dest[0] = r.rows[r.pos][0]
+	dest[1] = r.rows[r.pos][1]
+	r.pos++
+	return nil
+}
+
+// fakeCalls records every query/exec the queryFakeConn has seen, so tests
+// can assert on the rewritten query text and bound argument order.
+var (
+	fakeCallsMu sync.Mutex
+	fakeCalls   []fakeCall
+)
+
+type fakeCall struct {
+	query string
+	args  []driver.Value
+}
+
+func recordFakeCall(query string, args []driver.NamedValue) {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	fakeCallsMu.Lock()
+	fakeCalls = append(fakeCalls, fakeCall{query: query, args: values})
+	fakeCallsMu.Unlock()
+}
+
+func resetFakeCalls() {
+	fakeCallsMu.Lock()
+	fakeCalls = nil
+	fakeCallsMu.Unlock()
+}
+
+func lastFakeCall() fakeCall {
+	fakeCallsMu.Lock()
+	defer fakeCallsMu.Unlock()
+	if len(fakeCalls) == 0 {
+		return fakeCall{}
+	}
+	return fakeCalls[len(fakeCalls)-1]
+}
+
+type person struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func openFakeQueryDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlutils-fake-query", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestSelectStructsScansAllRows(t *testing.T) {
+	db := openFakeQueryDB(t)
+
+	var people []person
+	if err := SelectStructs(context.Background(), db, &people, "select id, name from people"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if len(people) != 2 {
+		t.Fatalf("expected 2 people, got %d", len(people))
+	}
+	if people[0].ID != 1 || people[0].Name != "alice" {
+		t.Fatalf("unexpected first row: %+v", people[0])
+	}
+	if people[1].ID != 2 || people[1].Name != "bob" {
+		t.Fatalf("unexpected second row: %+v", people[1])
+	}
+}
+
+func TestSelectStructsOfPointers(t *testing.T) {
+	db := openFakeQueryDB(t)
+
+	var people []*person
+	if err := SelectStructs(context.Background(), db, &people, "select id, name from people"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if len(people) != 2 || people[0].Name != "alice" {
+		t.Fatalf("unexpected result: %+v", people)
+	}
+}
+
+func TestGetStructScansFirstRow(t *testing.T) {
+	db := openFakeQueryDB(t)
+
+	var p person
+	if err := GetStruct(context.Background(), db, &p, "select id, name from people where id = ?", 1); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if p.ID != 1 || p.Name != "alice" {
+		t.Fatalf("unexpected row: %+v", p)
+	}
+}
+
+func TestGetStructRejectsNonStructPointer(t *testing.T) {
+	db := openFakeQueryDB(t)
+
+	var notAStruct int
+	if err := GetStruct(context.Background(), db, &notAStruct, "select id, name from people"); err == nil {
+		t.Fatalf("expected an error for a non-struct destination")
+	}
+}
+
+func TestNamedQueryRewritesPlaceholdersInOrder(t *testing.T) {
+	db := openFakeQueryDB(t)
+	resetFakeCalls()
+
+	rows, err := NamedQuery(context.Background(), db, "select * from people where id = :id", map[string]interface{}{"id": 5})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	rows.Close()
+
+	call := lastFakeCall()
+	if call.query != "select * from people where id = ?" {
+		t.Fatalf("unexpected rewritten query: %s", call.query)
+	}
+	if len(call.args) != 1 || call.args[0] != int64(5) {
+		t.Fatalf("unexpected args: %+v", call.args)
+	}
+}
+
+func TestNamedExecRewritesPlaceholdersInOrder(t *testing.T) {
+	db := openFakeQueryDB(t)
+	resetFakeCalls()
+
+	res, err := NamedExec(context.Background(), db, "update people set name = :name where id = :id", map[string]interface{}{
+		"id":   5,
+		"name": "carol",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if affected, _ := res.RowsAffected(); affected != 1 {
+		t.Fatalf("expected 1 row affected, got %d", affected)
+	}
+
+	call := lastFakeCall()
+	if call.query != "update people set name = ? where id = ?" {
+		t.Fatalf("unexpected rewritten query: %s", call.query)
+	}
+	if len(call.args) != 2 || call.args[0] != "carol" || call.args[1] != int64(5) {
+		t.Fatalf("unexpected args: %+v", call.args)
+	}
+}
+
+func TestNamedArgGetterIsCaseInsensitiveForMapAndRowMap(t *testing.T) {
+	mapGet, err := namedArgGetter(map[string]interface{}{"ID": 5})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if v, ok := mapGet("id"); !ok || v != 5 {
+		t.Fatalf("expected case-insensitive lookup to find ID, got %v, %v", v, ok)
+	}
+
+	rowGet, err := namedArgGetter(RowMap{"ID": CellData{Valid: true, String: "5"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	v, ok := rowGet("id")
+	if !ok {
+		t.Fatalf("expected case-insensitive lookup to find ID")
+	}
+	ns, isNullString := v.(*sql.NullString)
+	if !isNullString || ns.String != "5" {
+		t.Fatalf("unexpected value: %+v", v)
+	}
+}
@@ -0,0 +1,93 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package sqlutils
+
+import "testing"
+
+func TestCompileNamedBasic(t *testing.T) {
+	query, args, err := compileNamed("select * from t where id = :id and name = :name", map[string]interface{}{
+		"id":   5,
+		"name": "bob",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if query != "select * from t where id = ? and name = ?" {
+		t.Fatalf("unexpected query: %s", query)
+	}
+	if len(args) != 2 || args[0] != 5 || args[1] != "bob" {
+		t.Fatalf("unexpected args: %+v", args)
+	}
+}
+
+func TestCompileNamedMissingParameter(t *testing.T) {
+	_, _, err := compileNamed("select * from t where id = :id", map[string]interface{}{})
+	if err == nil {
+		t.Fatalf("expected an error for a missing parameter")
+	}
+}
+
+func TestCompileNamedIgnoresColonInsideStringLiteral(t *testing.T) {
+	query, args, err := compileNamed("select * from t where note = 'a:b' and id = :id", map[string]interface{}{
+		"id": 5,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if query != "select * from t where note = 'a:b' and id = ?" {
+		t.Fatalf("unexpected query: %s", query)
+	}
+	if len(args) != 1 || args[0] != 5 {
+		t.Fatalf("unexpected args: %+v", args)
+	}
+}
+
+func TestCompileNamedIgnoresPostgresCast(t *testing.T) {
+	query, args, err := compileNamed("select cast(x as text) where note = 'a:b' and id = :id::text", map[string]interface{}{
+		"id": 5,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if query != "select cast(x as text) where note = 'a:b' and id = ?::text" {
+		t.Fatalf("unexpected query: %s", query)
+	}
+	if len(args) != 1 || args[0] != 5 {
+		t.Fatalf("unexpected args: %+v", args)
+	}
+}
+
+func TestRebindQuestion(t *testing.T) {
+	query := Rebind(Question, "select * from t where id = ?")
+	if query != "select * from t where id = ?" {
+		t.Fatalf("unexpected query: %s", query)
+	}
+}
+
+func TestRebindDollar(t *testing.T) {
+	query := Rebind(Dollar, "select * from t where id = ? and name = ?")
+	if query != "select * from t where id = $1 and name = $2" {
+		t.Fatalf("unexpected query: %s", query)
+	}
+}
+
+func TestRebindIgnoresPlaceholderInStringLiteral(t *testing.T) {
+	query := Rebind(Dollar, "select * from t where note = 'what?' and id = ?")
+	if query != "select * from t where note = 'what?' and id = $1" {
+		t.Fatalf("unexpected query: %s", query)
+	}
+}
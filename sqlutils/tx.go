@@ -0,0 +1,199 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package sqlutils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/openark/golib/log"
+)
+
+// Isolation mirrors database/sql's IsolationLevel, letting callers pick an
+// isolation level without importing database/sql themselves.
+type Isolation int
+
+const (
+	IsolationDefault Isolation = iota
+	IsolationReadUncommitted
+	IsolationReadCommitted
+	IsolationWriteCommitted
+	IsolationRepeatableRead
+	IsolationSnapshot
+	IsolationSerializable
+	IsolationLinearizable
+)
+
+// TxOptions builds the *sql.TxOptions to pass to WithTx/WithTxRetry for this
+// isolation level.
+func (this Isolation) TxOptions(readOnly bool) *sql.TxOptions {
+	return &sql.TxOptions{Isolation: sql.IsolationLevel(this), ReadOnly: readOnly}
+}
+
+// WithTx runs fn inside a transaction opened with opts, committing on
+// success and rolling back if fn returns an error or panics.
+func WithTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(*sql.Tx) error) (err error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	err = fn(tx)
+	return err
+}
+
+// WithTxRetry behaves like WithTx, but runs the whole transaction up to
+// maxAttempts times in total, retrying when it fails on a MySQL deadlock (error 1213) or lock
+// wait timeout (error 1205), or a Postgres serialization failure
+// (SQLSTATE 40001) or deadlock (SQLSTATE 40P01). Retries back off
+// exponentially with jitter.
+func WithTxRetry(ctx context.Context, db *sql.DB, opts *sql.TxOptions, maxAttempts int, fn func(*sql.Tx) error) (err error) {
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		err = WithTx(ctx, db, opts, fn)
+		if err == nil || !isRetryableTxError(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryBackoff(attempt)):
+		}
+	}
+	return err
+}
+
+// retryBackoff returns an exponentially growing, jittered delay for the
+// given zero-based attempt number, capped at 2 seconds.
+func retryBackoff(attempt int) time.Duration {
+	const (
+		base    = 50 * time.Millisecond
+		maxWait = 2 * time.Second
+	)
+	d := base * time.Duration(1<<uint(attempt))
+	if d > maxWait || d <= 0 {
+		d = maxWait
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// isRetryableTxError reports whether err looks like a transient deadlock or
+// serialization failure that is safe to retry by re-running the whole
+// transaction.
+func isRetryableTxError(err error) bool {
+	msg := err.Error()
+	if strings.Contains(msg, "Error 1213") || strings.Contains(msg, "Error 1205") {
+		return true
+	}
+	switch sqlStateOf(err) {
+	case "40001", "40P01":
+		return true
+	}
+	return false
+}
+
+// sqlStateOf extracts a Postgres-style SQLSTATE code from err, if the
+// underlying driver error exposes one via an exported string field named
+// "Code" (as lib/pq and pgx's error types do). This avoids a hard dependency
+// on either driver package.
+func sqlStateOf(err error) string {
+	v := reflect.ValueOf(err)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	f := v.FieldByName("Code")
+	if f.IsValid() && f.Kind() == reflect.String {
+		return f.String()
+	}
+	return ""
+}
+
+// TxQueryRowsMap is QueryRowsMapContext's counterpart for a caller-owned
+// transaction.
+func TxQueryRowsMap(ctx context.Context, tx *sql.Tx, query string, on_row func(RowMap) error, args ...interface{}) (err error) {
+	defer func() {
+		if derr := recover(); derr != nil {
+			err = fmt.Errorf("TxQueryRowsMap unexpected error: %+v", derr)
+		}
+	}()
+
+	var rows *sql.Rows
+	rows, err = tx.QueryContext(ctx, query, args...)
+	if rows != nil {
+		defer rows.Close()
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return log.Errore(err)
+	}
+	err = ScanRowsToMaps(rows, on_row)
+	return
+}
+
+// TxExec executes query with args against a caller-owned transaction.
+func TxExec(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
+	return tx.ExecContext(ctx, query, args...)
+}
+
+// validSavepointName rejects anything but a plain identifier, since
+// SAVEPOINT/ROLLBACK TO/RELEASE don't accept bound parameters for the
+// savepoint name and it is concatenated directly into the statement.
+var validSavepointName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Savepoint establishes a savepoint named name within tx.
+func Savepoint(tx *sql.Tx, name string) error {
+	if !validSavepointName.MatchString(name) {
+		return fmt.Errorf("sqlutils: invalid savepoint name %q", name)
+	}
+	_, err := tx.Exec(fmt.Sprintf("SAVEPOINT %s", name))
+	return err
+}
+
+// RollbackTo rolls tx back to the savepoint named name, without ending tx.
+func RollbackTo(tx *sql.Tx, name string) error {
+	if !validSavepointName.MatchString(name) {
+		return fmt.Errorf("sqlutils: invalid savepoint name %q", name)
+	}
+	_, err := tx.Exec(fmt.Sprintf("ROLLBACK TO SAVEPOINT %s", name))
+	return err
+}
+
+// ReleaseSavepoint releases the savepoint named name, making it unavailable
+// to future RollbackTo calls within tx.
+func ReleaseSavepoint(tx *sql.Tx, name string) error {
+	if !validSavepointName.MatchString(name) {
+		return fmt.Errorf("sqlutils: invalid savepoint name %q", name)
+	}
+	_, err := tx.Exec(fmt.Sprintf("RELEASE SAVEPOINT %s", name))
+	return err
+}
@@ -0,0 +1,108 @@
+/*
+   Copyright 2014 Outbrain Inc.
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package sqlutils
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIsRetryableTxErrorMySQLDeadlock(t *testing.T) {
+	err := errors.New("Error 1213: Deadlock found when trying to get lock")
+	if !isRetryableTxError(err) {
+		t.Fatalf("expected a MySQL deadlock error to be retryable")
+	}
+}
+
+func TestIsRetryableTxErrorMySQLLockWaitTimeout(t *testing.T) {
+	err := errors.New("Error 1205: Lock wait timeout exceeded")
+	if !isRetryableTxError(err) {
+		t.Fatalf("expected a MySQL lock wait timeout error to be retryable")
+	}
+}
+
+func TestIsRetryableTxErrorPostgresSerializationFailure(t *testing.T) {
+	err := &fakePQError{Code: "40001"}
+	if !isRetryableTxError(err) {
+		t.Fatalf("expected SQLSTATE 40001 to be retryable")
+	}
+}
+
+func TestIsRetryableTxErrorNonRetryable(t *testing.T) {
+	err := errors.New("syntax error near 'SELEC'")
+	if isRetryableTxError(err) {
+		t.Fatalf("expected a plain syntax error not to be retryable")
+	}
+}
+
+// fakePQError mimics the shape of lib/pq and pgx error types: a struct with
+// an exported string field named Code holding the SQLSTATE.
+type fakePQError struct {
+	Code string
+}
+
+func (this *fakePQError) Error() string {
+	return "pq: fake error " + this.Code
+}
+
+func TestSqlStateOfExtractsCode(t *testing.T) {
+	err := &fakePQError{Code: "40P01"}
+	if got := sqlStateOf(err); got != "40P01" {
+		t.Fatalf("got %q, want %q", got, "40P01")
+	}
+}
+
+func TestSqlStateOfUnknownErrorType(t *testing.T) {
+	if got := sqlStateOf(errors.New("boom")); got != "" {
+		t.Fatalf("expected no SQLSTATE for a plain error, got %q", got)
+	}
+}
+
+func TestRetryBackoffIsBoundedAndGrows(t *testing.T) {
+	var prev time.Duration
+	for attempt := 0; attempt < 10; attempt++ {
+		d := retryBackoff(attempt)
+		if d <= 0 || d > 2*time.Second {
+			t.Fatalf("attempt %d: backoff %s out of bounds", attempt, d)
+		}
+		// Below the cap, an attempt's shortest delay equals the previous
+		// attempt's longest one, so delays never shrink until the cap.
+		if prev < time.Second && d < prev {
+			t.Fatalf("attempt %d: backoff %s shorter than previous %s", attempt, d, prev)
+		}
+		prev = d
+	}
+}
+
+func TestSavepointRejectsInvalidName(t *testing.T) {
+	if err := Savepoint(nil, "not a valid name"); err == nil {
+		t.Fatalf("expected an error for an invalid savepoint name")
+	}
+}
+
+func TestRollbackToRejectsInvalidName(t *testing.T) {
+	if err := RollbackTo(nil, "1_starts_with_digit"); err == nil {
+		t.Fatalf("expected an error for an invalid savepoint name")
+	}
+}
+
+func TestReleaseSavepointRejectsInvalidName(t *testing.T) {
+	if err := ReleaseSavepoint(nil, ""); err == nil {
+		t.Fatalf("expected an error for an empty savepoint name")
+	}
+}